@@ -20,28 +20,51 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	appsinformers "k8s.io/client-go/informers/apps/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	v1alpha1 "submarine-cloud-v2/pkg/apis/submarine/v1alpha1"
 	clientset "submarine-cloud-v2/pkg/generated/clientset/versioned"
 	submarinescheme "submarine-cloud-v2/pkg/generated/clientset/versioned/scheme"
 	"submarine-cloud-v2/pkg/helm"
 	informers "submarine-cloud-v2/pkg/generated/informers/externalversions/submarine/v1alpha1"
 	listers "submarine-cloud-v2/pkg/generated/listers/submarine/v1alpha1"
+	"sync"
 	"time"
 )
 
 const controllerAgentName = "submarine-controller"
 
+// submarineFinalizer is added to every Submarine CR so the controller can
+// tear down the Helm releases and namespace it created before the object is
+// garbage-collected.
+const submarineFinalizer = "submarine.apache.org/finalizer"
+
+// submarineNamespaceOwnerAnnotation marks a Namespace as having been
+// auto-created by the controller for a particular Submarine CR (value is
+// that CR's "namespace/name" key). Namespaces are cluster-scoped, so they
+// can't carry an OwnerReference to a namespaced Submarine; this annotation
+// is what lets reconcileNamespace and handleSubmarineDeletion tell a
+// namespace they created apart from one a user happened to name in
+// Spec.Namespace.
+const submarineNamespaceOwnerAnnotation = "submarine.apache.org/created-for"
+
 // Controller is the controller implementation for Foo resources
 type Controller struct {
 	// kubeclientset is a standard kubernetes clientset
@@ -52,6 +75,18 @@ type Controller struct {
 	submarinesLister listers.SubmarineLister
 	submarinesSynced cache.InformerSynced
 
+	deploymentsLister appslisters.DeploymentLister
+	deploymentsSynced cache.InformerSynced
+
+	servicesLister corelisters.ServiceLister
+	servicesSynced cache.InformerSynced
+
+	podsLister corelisters.PodLister
+	podsSynced cache.InformerSynced
+
+	namespacesLister corelisters.NamespaceLister
+	namespacesSynced cache.InformerSynced
+
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
@@ -61,50 +96,24 @@ type Controller struct {
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
-}
 
-// NewController returns a new sample controller
-func NewController(
-	kubeclientset kubernetes.Interface,
-	submarineclientset clientset.Interface,
-	deploymentInformer appsinformers.DeploymentInformer,
-	submarineInformer informers.SubmarineInformer) *Controller {
-
-	// TODO: Create event broadcaster
-	// Add Submarine types to the default Kubernetes Scheme so Events can be
-	// logged for Submarine types.
-	utilruntime.Must(submarinescheme.AddToScheme(scheme.Scheme))
-	klog.V(4).Info("Creating event broadcaster")
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartStructuredLogging(0)
-	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
-
-	// Initialize controller
-	controller := &Controller{
-		kubeclientset:      kubeclientset,
-		submarineclientset: submarineclientset,
-		submarinesLister:   submarineInformer.Lister(),
-		submarinesSynced:   submarineInformer.Informer().HasSynced,
-		workqueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Submarines"),
-		recorder:           recorder,
-	}
-
-	// Setting up event handler for Submarine
-	klog.Info("Setting up event handlers")
-	submarineInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.enqueueSubmarine,
-		UpdateFunc: func(old, new interface{}) {
-			controller.enqueueSubmarine(new)
-		},
-	})
+	// workers is the number of worker goroutines Run starts to drain the
+	// workqueue.
+	workers int
 
-	// TODO: Setting up event handler for other resources. E.g. namespace
+	// helmReleaseManager installs/upgrades/uninstalls the Helm releases a
+	// Submarine CR needs.
+	helmReleaseManager *helm.ReleaseManager
 
-	return controller
+	// helmReleasesMu guards helmReleases.
+	helmReleasesMu sync.Mutex
+	// helmReleases tracks the Helm releases installed for each Submarine CR,
+	// keyed by "namespace/name", so that a delete can uninstall every
+	// subchart that was created for it.
+	helmReleases map[string][]string
 }
 
-func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
+func (c *Controller) Run(stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.workqueue.ShutDown()
 
@@ -113,41 +122,19 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 
 	// Wait for the caches to be synced before starting workers
 	klog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.submarinesSynced); !ok {
+	synced := []cache.InformerSynced{c.submarinesSynced}
+	for _, s := range []cache.InformerSynced{c.deploymentsSynced, c.servicesSynced, c.podsSynced, c.namespacesSynced} {
+		if s != nil {
+			synced = append(synced, s)
+		}
+	}
+	if ok := cache.WaitForCacheSync(stopCh, synced...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
-	// Example: HelmInstall (can be removed in the future):
-	// This is equal to:
-	// 		helm repo add k8s-as-helm https://ameijer.github.io/k8s-as-helm/
-	// .	helm repo update
-	//  	helm install helm-install-example-release k8s-as-helm/svc --set ports[0].protocol=TCP,ports[0].port=80,ports[0].targetPort=9376
-	// Useful Links:
-	//   (1) https://github.com/PrasadG193/helm-clientgo-example
-	// . (2) https://github.com/ameijer/k8s-as-helm/tree/master/charts/svc
-	klog.Info("[Helm example] Install")
-	helmActionConfig := helm.HelmInstall(
-		"https://ameijer.github.io/k8s-as-helm/",
-		"k8s-as-helm",
-		"svc",
-		"helm-install-example-release",
-		"default",
-		map[string]string {
-			"set": "ports[0].protocol=TCP,ports[0].port=80,ports[0].targetPort=9376",
-		},
-	)
-
-	klog.Info("[Helm example] Sleep 60 seconds")
-	time.Sleep(time.Duration(60) * time.Second)
-
-	klog.Info("[Helm example] Uninstall")
-	helm.HelmUninstall("helm-install-example-release", helmActionConfig)
-
-
-
 	klog.Info("Starting workers")
 	// Launch two workers to process Submarine resources
-	for i := 0; i < threadiness; i++ {
+	for i := 0; i < c.workers; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
@@ -166,8 +153,16 @@ func (c *Controller) runWorker() {
 	}
 }
 
+// maxRetries is the number of times a workqueue item is retried before it is
+// dropped. With the default rate limiter (5ms base delay, doubling on each
+// failure) the 15 retries span a little under three minutes (about 164s)
+// before the controller gives up on the key.
+const maxRetries = 15
+
 // processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it, by calling the syncHandler.
+// attempt to process it, by calling the syncHandler. On error the key is
+// requeued with rate-limited backoff, up to maxRetries, instead of being
+// dropped silently.
 func (c *Controller) processNextWorkItem() bool {
 	obj, shutdown := c.workqueue.Get()
 	if shutdown {
@@ -176,23 +171,53 @@ func (c *Controller) processNextWorkItem() bool {
 
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
-		// TODO: Maintain workqueue
 		defer c.workqueue.Done(obj)
-		key, _ := obj.(string)
-		c.syncHandler(key)
+		key, ok := obj.(string)
+		if !ok {
+			c.workqueue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+		if err := c.syncHandler(key); err != nil {
+			return fmt.Errorf("error syncing '%s': %v", key, err)
+		}
 		c.workqueue.Forget(obj)
 		klog.Infof("Successfully synced '%s'", key)
 		return nil
 	}(obj)
 
 	if err != nil {
-		utilruntime.HandleError(err)
+		c.handleSyncError(obj, err)
 		return true
 	}
 
 	return true
 }
 
+// handleSyncError requeues obj with rate-limited backoff unless it has
+// already been retried maxRetries times, in which case it is dropped and a
+// Warning event is emitted so the failure is visible on `kubectl describe
+// submarine`.
+func (c *Controller) handleSyncError(obj interface{}, err error) {
+	utilruntime.HandleError(err)
+
+	if c.workqueue.NumRequeues(obj) < maxRetries {
+		c.workqueue.AddRateLimited(obj)
+		return
+	}
+
+	klog.Warningf("Dropping key %q out of the workqueue after %d retries: %v", obj, maxRetries, err)
+	c.workqueue.Forget(obj)
+
+	if key, ok := obj.(string); ok {
+		if namespace, name, splitErr := cache.SplitMetaNamespaceKey(key); splitErr == nil {
+			if submarine, getErr := c.submarinesLister.Submarines(namespace).Get(name); getErr == nil {
+				c.recorder.Eventf(submarine, corev1.EventTypeWarning, "SyncFailed", "Giving up syncing after %d retries: %v", maxRetries, err)
+			}
+		}
+	}
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the Foo resource
 // with the current status of the resource.
@@ -215,15 +240,602 @@ func (c *Controller) syncHandler(key string) error {
 			utilruntime.HandleError(fmt.Errorf("submarine '%s' in work queue no longer exists", key))
 			return nil
 		}
+		return err
 	}
 
 	klog.Info("syncHandler: ", key)
 
+	// If the Submarine is being deleted, run the teardown instead of the
+	// normal reconcile path.
+	if submarine.ObjectMeta.DeletionTimestamp != nil {
+		return c.handleSubmarineDeletion(submarine)
+	}
+
+	if !c.hasFinalizer(submarine) {
+		if err := c.addFinalizer(submarine); err != nil {
+			return err
+		}
+	}
+
 	// Print out the spec of the Submarine resource
 	b, err := json.MarshalIndent(submarine.Spec, "", "  ")
 	fmt.Println(string(b))
 
-	return nil
+	newStatus := submarine.Status.DeepCopy()
+	newStatus.ObservedGeneration = submarine.Generation
+
+	deploymentReady, err := c.reconcileDeployment(submarine)
+	if err != nil {
+		return err
+	}
+	newStatus.DeploymentReady = deploymentReady
+
+	servicesReady, err := c.reconcileServices(submarine)
+	if err != nil {
+		return err
+	}
+	newStatus.ServicesReady = servicesReady
+
+	podsReady, err := c.reconcilePods(submarine)
+	if err != nil {
+		return err
+	}
+	newStatus.PodsReady = podsReady
+
+	namespaceReady, err := c.reconcileNamespace(submarine)
+	if err != nil {
+		return err
+	}
+	newStatus.NamespaceReady = namespaceReady
+
+	helmReleases, err := c.reconcileHelmReleases(submarine)
+	if err != nil {
+		return err
+	}
+	newStatus.HelmReleases = helmReleases
+
+	return c.updateSubmarineStatus(submarine, newStatus)
+}
+
+// reconcileHelmReleases installs or upgrades every subchart listed in
+// submarine.Spec.HelmCharts and uninstalls any previously tracked release
+// that's no longer in the spec, returning the per-release status to persist
+// on the Submarine CR. Releases are recorded in c.helmReleases (the durable
+// backstop is submarine.Status.HelmReleases, see handleSubmarineDeletion) as
+// soon as each install/upgrade succeeds, rather than only once the whole
+// loop finishes, so a failure partway through doesn't orphan the releases
+// that already succeeded.
+func (c *Controller) reconcileHelmReleases(submarine *v1alpha1.Submarine) ([]v1alpha1.HelmReleaseStatus, error) {
+	if c.helmReleaseManager == nil {
+		return submarine.Status.HelmReleases, nil
+	}
+
+	key := fmt.Sprintf("%s/%s", submarine.Namespace, submarine.Name)
+	namespace := submarine.Spec.Namespace
+	if namespace == "" {
+		namespace = submarine.Namespace
+	}
+
+	desired := make(map[string]struct{}, len(submarine.Spec.HelmCharts))
+	for _, chart := range submarine.Spec.HelmCharts {
+		desired[chart.ReleaseName] = struct{}{}
+	}
+
+	c.helmReleasesMu.Lock()
+	tracked := append([]string(nil), c.helmReleases[key]...)
+	c.helmReleasesMu.Unlock()
+
+	// Uninstall releases that are tracked but no longer desired, e.g.
+	// because a chart was removed from submarine.Spec.HelmCharts.
+	for _, name := range tracked {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		klog.Infof("Uninstalling helm release %s for submarine %s: no longer in spec", name, key)
+		if err := c.helmReleaseManager.Uninstall(name, namespace); err != nil {
+			return nil, fmt.Errorf("failed to uninstall helm release %s for submarine %s: %v", name, key, err)
+		}
+		c.forgetHelmRelease(key, name)
+	}
+
+	var statuses []v1alpha1.HelmReleaseStatus
+	for _, chart := range submarine.Spec.HelmCharts {
+		rel, err := c.helmReleaseManager.InstallOrUpgrade(chart.ReleaseName, namespace, chart.ChartRef, &helm.Values{
+			Namespace: namespace,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to install/upgrade helm release %s for submarine %s: %v", chart.ReleaseName, key, err)
+		}
+		c.recordHelmRelease(key, rel.Name)
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "HelmReleaseSynced", "Synced helm release %s (revision %d)", rel.Name, rel.Version)
+		statuses = append(statuses, v1alpha1.HelmReleaseStatus{
+			Name:     rel.Name,
+			Chart:    rel.Chart.Metadata.Version,
+			Revision: rel.Version,
+		})
+	}
+
+	return statuses, nil
+}
+
+// recordHelmRelease adds name to the set of releases tracked for key, if
+// it isn't already there.
+func (c *Controller) recordHelmRelease(key, name string) {
+	c.helmReleasesMu.Lock()
+	defer c.helmReleasesMu.Unlock()
+	for _, r := range c.helmReleases[key] {
+		if r == name {
+			return
+		}
+	}
+	c.helmReleases[key] = append(c.helmReleases[key], name)
+}
+
+// forgetHelmRelease removes name from the set of releases tracked for key.
+func (c *Controller) forgetHelmRelease(key, name string) {
+	c.helmReleasesMu.Lock()
+	defer c.helmReleasesMu.Unlock()
+	kept := c.helmReleases[key][:0]
+	for _, r := range c.helmReleases[key] {
+		if r != name {
+			kept = append(kept, r)
+		}
+	}
+	c.helmReleases[key] = kept
+}
+
+// labelsForSubmarine returns the label set every resource owned by
+// submarine is stamped with, so owned children can be found again with a
+// label selector.
+func labelsForSubmarine(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": controllerAgentName,
+		"submarine-name":               name,
+	}
+}
+
+// newOwnerReference returns an OwnerReference that makes submarine the
+// controller of a child resource, so metav1.GetControllerOf can later map
+// the child back to it and the API server garbage-collects the child when
+// submarine is deleted.
+func newOwnerReference(submarine *v1alpha1.Submarine) metav1.OwnerReference {
+	return *metav1.NewControllerRef(submarine, v1alpha1.SchemeGroupVersion.WithKind("Submarine"))
+}
+
+// reconcileDeployment ensures the Deployment named by
+// submarine.Spec.DeploymentName exists with submarine.Spec.Replicas
+// replicas, creating or updating it as needed. It returns whether the
+// Deployment is fully available.
+func (c *Controller) reconcileDeployment(submarine *v1alpha1.Submarine) (bool, error) {
+	if c.deploymentsLister == nil {
+		// Build() allows a Controller without a deployment informer; treat
+		// the Deployment as unmanaged rather than dereferencing a nil lister.
+		return true, nil
+	}
+
+	deploymentName := submarine.Spec.DeploymentName
+	if deploymentName == "" {
+		utilruntime.HandleError(fmt.Errorf("%s: deployment name must be specified", submarine.Name))
+		return false, nil
+	}
+
+	deployment, err := c.deploymentsLister.Deployments(submarine.Namespace).Get(deploymentName)
+	if errors.IsNotFound(err) {
+		deployment, err = c.kubeclientset.AppsV1().Deployments(submarine.Namespace).Create(newDeployment(submarine))
+		if err != nil {
+			return false, err
+		}
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "Created", "Created deployment %s/%s", submarine.Namespace, deploymentName)
+	} else if err != nil {
+		return false, err
+	}
+
+	if !metav1.IsControlledBy(deployment, submarine) {
+		return false, fmt.Errorf("deployment %s already exists and is not managed by submarine %s", deploymentName, submarine.Name)
+	}
+
+	if submarine.Spec.Replicas != nil && *submarine.Spec.Replicas != *deployment.Spec.Replicas {
+		klog.V(4).Infof("Submarine %s replicas: %d, deployment replicas: %d", submarine.Name, *submarine.Spec.Replicas, *deployment.Spec.Replicas)
+		deploymentCopy := deployment.DeepCopy()
+		deploymentCopy.Spec.Replicas = submarine.Spec.Replicas
+		deployment, err = c.kubeclientset.AppsV1().Deployments(submarine.Namespace).Update(deploymentCopy)
+		if err != nil {
+			return false, err
+		}
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "Updated", "Scaled deployment %s/%s to %d replicas", submarine.Namespace, deploymentName, *submarine.Spec.Replicas)
+	}
+
+	return deployment.Status.Replicas == deployment.Status.ReadyReplicas && deployment.Status.Replicas > 0, nil
+}
+
+// newDeployment creates a new Deployment for a Submarine resource. It is
+// owned by the Submarine so that deleting the Submarine cascades to it.
+func newDeployment(submarine *v1alpha1.Submarine) *appsv1.Deployment {
+	labels := labelsForSubmarine(submarine.Name)
+	ownerRef := newOwnerReference(submarine)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            submarine.Spec.DeploymentName,
+			Namespace:       submarine.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{ownerRef},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: submarine.Spec.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "submarine",
+							Image: "apache/submarine:latest",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// reconcileServices ensures the Service named by submarine.Spec.ServiceName
+// exposes the Deployment's pods on submarine.Spec.ServicePort, creating or
+// updating it as needed, mirroring reconcileDeployment. A Submarine that
+// doesn't set ServiceName has no Service to manage, so this step does
+// nothing and reports ready (unlike an unset DeploymentName, which
+// reconcileDeployment reports as an error and as not ready).
+func (c *Controller) reconcileServices(submarine *v1alpha1.Submarine) (bool, error) {
+	if c.servicesLister == nil {
+		// Build() allows a Controller without a service informer; treat the
+		// Service as unmanaged rather than dereferencing a nil lister.
+		return true, nil
+	}
+	if submarine.Spec.ServiceName == "" {
+		return true, nil
+	}
+
+	service, err := c.servicesLister.Services(submarine.Namespace).Get(submarine.Spec.ServiceName)
+	if errors.IsNotFound(err) {
+		service, err = c.kubeclientset.CoreV1().Services(submarine.Namespace).Create(newService(submarine))
+		if err != nil {
+			return false, err
+		}
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "Created", "Created service %s/%s", submarine.Namespace, submarine.Spec.ServiceName)
+	} else if err != nil {
+		return false, err
+	}
+
+	if !metav1.IsControlledBy(service, submarine) {
+		return false, fmt.Errorf("service %s already exists and is not managed by submarine %s", submarine.Spec.ServiceName, submarine.Name)
+	}
+
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != submarine.Spec.ServicePort {
+		klog.V(4).Infof("Submarine %s service port: %d, service port: %d", submarine.Name, submarine.Spec.ServicePort, servicePort(service))
+		serviceCopy := service.DeepCopy()
+		serviceCopy.Spec.Ports = []corev1.ServicePort{{
+			Port:       submarine.Spec.ServicePort,
+			TargetPort: intstr.FromInt(int(submarine.Spec.ServicePort)),
+		}}
+		service, err = c.kubeclientset.CoreV1().Services(submarine.Namespace).Update(serviceCopy)
+		if err != nil {
+			return false, err
+		}
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "Updated", "Updated service %s/%s to port %d", submarine.Namespace, submarine.Spec.ServiceName, submarine.Spec.ServicePort)
+	}
+
+	return true, nil
+}
+
+// servicePort returns service's single port, or 0 if it doesn't have exactly
+// one, for use in a log message only.
+func servicePort(service *corev1.Service) int32 {
+	if len(service.Spec.Ports) != 1 {
+		return 0
+	}
+	return service.Spec.Ports[0].Port
+}
+
+// newService creates a new Service for a Submarine resource, selecting the
+// same Pods reconcileDeployment's Deployment creates. It is owned by the
+// Submarine so that deleting the Submarine cascades to it.
+func newService(submarine *v1alpha1.Submarine) *corev1.Service {
+	labels := labelsForSubmarine(submarine.Name)
+	ownerRef := newOwnerReference(submarine)
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            submarine.Spec.ServiceName,
+			Namespace:       submarine.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{ownerRef},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{{
+				Port:       submarine.Spec.ServicePort,
+				TargetPort: intstr.FromInt(int(submarine.Spec.ServicePort)),
+			}},
+		},
+	}
+}
+
+// reconcilePods lists the Pods owned by submarine and reports whether they
+// are all running, for use in Submarine.Status. Unlike Services and
+// Namespaces, Pods are never created, updated or deleted here: they belong
+// to the ReplicaSet that reconcileDeployment's Deployment manages, and a
+// controller that created bare Pods matching the same label selector would
+// fight the Deployment controller over ownership of them instead of
+// complementing it. So "diff against the desired set" for Pods means
+// diffing observed readiness, not existence.
+func (c *Controller) reconcilePods(submarine *v1alpha1.Submarine) (bool, error) {
+	if c.podsLister == nil {
+		// Build() allows a Controller without a pod informer; treat pod
+		// readiness as unknown-but-fine rather than dereferencing a nil
+		// lister.
+		return true, nil
+	}
+
+	selector := labels.SelectorFromSet(labelsForSubmarine(submarine.Name))
+	pods, err := c.podsLister.Pods(submarine.Namespace).List(selector)
+	if err != nil {
+		return false, err
+	}
+	if len(pods) == 0 {
+		return false, nil
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// reconcileNamespace ensures submarine.Spec.Namespace exists, creating it
+// (stamped with submarineNamespaceOwnerAnnotation) if it's missing. A
+// namespace the controller didn't create — because it already existed, or
+// because it's shared with another Submarine — is left alone and merely
+// observed for readiness; only namespaces carrying our annotation are ever
+// touched again by handleSubmarineDeletion.
+func (c *Controller) reconcileNamespace(submarine *v1alpha1.Submarine) (bool, error) {
+	if c.namespacesLister == nil {
+		// Build() allows a Controller without a namespace informer; treat
+		// the Namespace as unmanaged rather than dereferencing a nil lister.
+		return true, nil
+	}
+	if submarine.Spec.Namespace == "" {
+		return true, nil
+	}
+
+	ns, err := c.namespacesLister.Get(submarine.Spec.Namespace)
+	if errors.IsNotFound(err) {
+		ns, err = c.kubeclientset.CoreV1().Namespaces().Create(newNamespace(submarine))
+		if err != nil {
+			return false, err
+		}
+		c.recorder.Eventf(submarine, corev1.EventTypeNormal, "Created", "Created namespace %s", submarine.Spec.Namespace)
+	} else if err != nil {
+		return false, err
+	}
+
+	return ns.Status.Phase == corev1.NamespaceActive, nil
+}
+
+// newNamespace builds the Namespace the controller creates for
+// submarine.Spec.Namespace, annotated so handleSubmarineDeletion knows it's
+// safe to delete later.
+func newNamespace(submarine *v1alpha1.Submarine) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   submarine.Spec.Namespace,
+			Labels: labelsForSubmarine(submarine.Name),
+			Annotations: map[string]string{
+				submarineNamespaceOwnerAnnotation: fmt.Sprintf("%s/%s", submarine.Namespace, submarine.Name),
+			},
+		},
+	}
+}
+
+// handleNamespace enqueues the Submarine that owns ns, the same way
+// handleObject does for Deployments/Services/Pods. Namespaces can't carry an
+// OwnerReference to a namespaced Submarine, so ownership is read back from
+// submarineNamespaceOwnerAnnotation instead of metav1.GetControllerOf.
+func (c *Controller) handleNamespace(obj interface{}) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		ns, ok = tombstone.Obj.(*corev1.Namespace)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+	}
+
+	ownerKey, ok := ns.Annotations[submarineNamespaceOwnerAnnotation]
+	if !ok {
+		return
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(ownerKey)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid owner key %q on namespace %s: %v", ownerKey, ns.Name, err))
+		return
+	}
+
+	submarine, err := c.submarinesLister.Submarines(namespace).Get(name)
+	if err != nil {
+		klog.V(4).Infof("ignoring orphaned namespace '%s' of submarine '%s'", ns.Name, ownerKey)
+		return
+	}
+
+	c.enqueueSubmarine(submarine)
+}
+
+// updateSubmarineStatus persists newStatus on submarine via the status
+// subresource, if it differs from the current status.
+func (c *Controller) updateSubmarineStatus(submarine *v1alpha1.Submarine, newStatus *v1alpha1.SubmarineStatus) error {
+	if apiequality.Semantic.DeepEqual(&submarine.Status, newStatus) {
+		return nil
+	}
+	submarineCopy := submarine.DeepCopy()
+	submarineCopy.Status = *newStatus
+	_, err := c.submarineclientset.SubmarineV1alpha1().Submarines(submarine.Namespace).UpdateStatus(submarineCopy)
+	return err
+}
+
+// handleObject enqueues the owning Submarine of any owned resource
+// (Deployment, Service, Pod, ...) whenever that resource changes, so
+// out-of-band edits or deletions get reconciled back to the desired state.
+// It mirrors the sample-controller handleObject pattern: tombstones are
+// unwrapped before looking at the owner reference.
+func (c *Controller) handleObject(obj interface{}) {
+	var object metav1.Object
+	var ok bool
+	if object, ok = obj.(metav1.Object); !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		object, ok = tombstone.Obj.(metav1.Object)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
+	}
+
+	klog.V(4).Infof("Processing object: %s", object.GetName())
+	ownerRef := metav1.GetControllerOf(object)
+	if ownerRef == nil {
+		return
+	}
+
+	if ownerRef.Kind != "Submarine" {
+		return
+	}
+
+	submarine, err := c.submarinesLister.Submarines(object.GetNamespace()).Get(ownerRef.Name)
+	if err != nil {
+		klog.V(4).Infof("ignoring orphaned object '%s/%s' of submarine '%s'", object.GetNamespace(), object.GetName(), ownerRef.Name)
+		return
+	}
+
+	c.enqueueSubmarine(submarine)
+}
+
+// handleSubmarineDeletion tears down everything that was created for a
+// Submarine CR that is pending deletion: every Helm release previously
+// installed for it, the namespace it auto-created (if any), and finally its
+// finalizer so the API server can garbage-collect the object.
+func (c *Controller) handleSubmarineDeletion(submarine *v1alpha1.Submarine) error {
+	if !c.hasFinalizer(submarine) {
+		// Nothing left for us to clean up.
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%s", submarine.Namespace, submarine.Name)
+	klog.Infof("Tearing down Submarine %s", key)
+
+	// c.helmReleases is only a cache: it is empty whenever the controller
+	// restarts while a Submarine is already Terminating. The durable record
+	// of what was installed is submarine.Status.HelmReleases, so fall back
+	// to it (deduping against the cache) rather than risk uninstalling
+	// nothing.
+	c.helmReleasesMu.Lock()
+	releases := c.helmReleases[key]
+	delete(c.helmReleases, key)
+	c.helmReleasesMu.Unlock()
+
+	seen := make(map[string]bool, len(releases))
+	for _, release := range releases {
+		seen[release] = true
+	}
+	for _, r := range submarine.Status.HelmReleases {
+		if !seen[r.Name] {
+			releases = append(releases, r.Name)
+			seen[r.Name] = true
+		}
+	}
+
+	if c.helmReleaseManager == nil {
+		if len(releases) > 0 {
+			klog.Warningf("Submarine %s has %d helm release(s) to uninstall but no helmReleaseManager is configured; skipping uninstall", key, len(releases))
+		}
+	} else {
+		namespace := submarine.Spec.Namespace
+		if namespace == "" {
+			namespace = submarine.Namespace
+		}
+		for _, release := range releases {
+			klog.Infof("Uninstalling helm release %s for Submarine %s", release, key)
+			if err := c.helmReleaseManager.Uninstall(release, namespace); err != nil {
+				return fmt.Errorf("failed to uninstall helm release %s for submarine %s: %v", release, key, err)
+			}
+		}
+	}
+
+	if submarine.Spec.Namespace != "" {
+		ns, err := c.kubeclientset.CoreV1().Namespaces().Get(submarine.Spec.Namespace, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get namespace %s for submarine %s: %v", submarine.Spec.Namespace, key, err)
+		}
+		// Only delete the namespace if we're the ones who created it: it may
+		// instead be a pre-existing namespace the user pointed Spec.Namespace
+		// at, or one shared with another Submarine.
+		if err == nil && ns.Annotations[submarineNamespaceOwnerAnnotation] == key {
+			klog.Infof("Deleting namespace %s for Submarine %s", submarine.Spec.Namespace, key)
+			if err := c.kubeclientset.CoreV1().Namespaces().Delete(submarine.Spec.Namespace, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete namespace %s for submarine %s: %v", submarine.Spec.Namespace, key, err)
+			}
+		} else if err == nil {
+			klog.V(4).Infof("Not deleting namespace %s for Submarine %s: not created by this controller", submarine.Spec.Namespace, key)
+		}
+	}
+
+	return c.removeFinalizer(submarine)
+}
+
+// hasFinalizer reports whether submarine already carries our finalizer.
+func (c *Controller) hasFinalizer(submarine *v1alpha1.Submarine) bool {
+	for _, f := range submarine.ObjectMeta.Finalizers {
+		if f == submarineFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer adds submarineFinalizer to the Submarine CR so the object
+// cannot be garbage-collected before the controller has a chance to tear
+// down the resources it owns.
+func (c *Controller) addFinalizer(submarine *v1alpha1.Submarine) error {
+	submarineCopy := submarine.DeepCopy()
+	submarineCopy.ObjectMeta.Finalizers = append(submarineCopy.ObjectMeta.Finalizers, submarineFinalizer)
+	_, err := c.submarineclientset.SubmarineV1alpha1().Submarines(submarineCopy.Namespace).Update(submarineCopy)
+	return err
+}
+
+// removeFinalizer removes submarineFinalizer from the Submarine CR, allowing
+// the API server to finish deleting it.
+func (c *Controller) removeFinalizer(submarine *v1alpha1.Submarine) error {
+	submarineCopy := submarine.DeepCopy()
+	finalizers := submarineCopy.ObjectMeta.Finalizers[:0]
+	for _, f := range submarineCopy.ObjectMeta.Finalizers {
+		if f != submarineFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	submarineCopy.ObjectMeta.Finalizers = finalizers
+	_, err := c.submarineclientset.SubmarineV1alpha1().Submarines(submarineCopy.Namespace).Update(submarineCopy)
+	return err
 }
 
 // enqueueFoo takes a Submarine resource and converts it into a namespace/name
@@ -0,0 +1,225 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	clientset "submarine-cloud-v2/pkg/generated/clientset/versioned"
+	submarinescheme "submarine-cloud-v2/pkg/generated/clientset/versioned/scheme"
+	informers "submarine-cloud-v2/pkg/generated/informers/externalversions/submarine/v1alpha1"
+	"submarine-cloud-v2/pkg/helm"
+)
+
+// defaultWorkers is the number of worker goroutines Run starts when the
+// builder isn't told otherwise.
+const defaultWorkers = 2
+
+// ControllerBuilder builds a Controller incrementally. It exists so that the
+// constructor doesn't have to grow a new positional parameter every time the
+// controller needs to watch one more resource type: informers that aren't
+// supplied via a With* call simply aren't wired up.
+type ControllerBuilder struct {
+	kubeclientset      kubernetes.Interface
+	submarineclientset clientset.Interface
+
+	deploymentInformer appsinformers.DeploymentInformer
+	submarineInformer  informers.SubmarineInformer
+	serviceInformer    coreinformers.ServiceInformer
+	podInformer        coreinformers.PodInformer
+	namespaceInformer  coreinformers.NamespaceInformer
+
+	recorder           record.EventRecorder
+	workers            int
+	helmReleaseManager *helm.ReleaseManager
+
+	err error
+}
+
+// NewControllerBuilder returns an empty ControllerBuilder.
+func NewControllerBuilder() *ControllerBuilder {
+	return &ControllerBuilder{}
+}
+
+func (b *ControllerBuilder) WithKubeClient(kubeclientset kubernetes.Interface) *ControllerBuilder {
+	b.kubeclientset = kubeclientset
+	return b
+}
+
+func (b *ControllerBuilder) WithSubmarineClient(submarineclientset clientset.Interface) *ControllerBuilder {
+	b.submarineclientset = submarineclientset
+	return b
+}
+
+func (b *ControllerBuilder) WithDeploymentInformer(deploymentInformer appsinformers.DeploymentInformer) *ControllerBuilder {
+	b.deploymentInformer = deploymentInformer
+	return b
+}
+
+func (b *ControllerBuilder) WithSubmarineInformer(submarineInformer informers.SubmarineInformer) *ControllerBuilder {
+	b.submarineInformer = submarineInformer
+	return b
+}
+
+func (b *ControllerBuilder) WithServiceInformer(serviceInformer coreinformers.ServiceInformer) *ControllerBuilder {
+	b.serviceInformer = serviceInformer
+	return b
+}
+
+func (b *ControllerBuilder) WithPodInformer(podInformer coreinformers.PodInformer) *ControllerBuilder {
+	b.podInformer = podInformer
+	return b
+}
+
+func (b *ControllerBuilder) WithNamespaceInformer(namespaceInformer coreinformers.NamespaceInformer) *ControllerBuilder {
+	b.namespaceInformer = namespaceInformer
+	return b
+}
+
+// WithEventRecorder injects a custom record.EventRecorder, letting tests use
+// a record.FakeRecorder instead of the broadcaster Build would otherwise
+// create.
+func (b *ControllerBuilder) WithEventRecorder(recorder record.EventRecorder) *ControllerBuilder {
+	b.recorder = recorder
+	return b
+}
+
+// WithWorkers sets the number of worker goroutines Run starts. Defaults to
+// defaultWorkers if not called or called with n <= 0.
+func (b *ControllerBuilder) WithWorkers(n int) *ControllerBuilder {
+	b.workers = n
+	return b
+}
+
+// WithHelmReleaseManager sets the ReleaseManager the Controller uses to
+// install, upgrade and uninstall the Helm releases a Submarine CR needs.
+func (b *ControllerBuilder) WithHelmReleaseManager(helmReleaseManager *helm.ReleaseManager) *ControllerBuilder {
+	b.helmReleaseManager = helmReleaseManager
+	return b
+}
+
+// Build validates the required fields and assembles the Controller,
+// registering event handlers only for the informers that were actually
+// supplied.
+func (b *ControllerBuilder) Build() (*Controller, error) {
+	if b.kubeclientset == nil {
+		return nil, fmt.Errorf("controller builder: WithKubeClient is required")
+	}
+	if b.submarineclientset == nil {
+		return nil, fmt.Errorf("controller builder: WithSubmarineClient is required")
+	}
+	if b.submarineInformer == nil {
+		return nil, fmt.Errorf("controller builder: WithSubmarineInformer is required")
+	}
+
+	recorder := b.recorder
+	if recorder == nil {
+		utilruntime.Must(submarinescheme.AddToScheme(scheme.Scheme))
+		klog.V(4).Info("Creating event broadcaster")
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartStructuredLogging(0)
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: b.kubeclientset.CoreV1().Events("")})
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	}
+
+	workers := b.workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	controller := &Controller{
+		kubeclientset:      b.kubeclientset,
+		submarineclientset: b.submarineclientset,
+		submarinesLister:   b.submarineInformer.Lister(),
+		submarinesSynced:   b.submarineInformer.Informer().HasSynced,
+		workqueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Submarines"),
+		recorder:           recorder,
+		workers:            workers,
+		helmReleaseManager: b.helmReleaseManager,
+		helmReleases:       make(map[string][]string),
+	}
+
+	klog.Info("Setting up event handlers")
+	b.submarineInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueSubmarine,
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueSubmarine(new)
+		},
+		DeleteFunc: controller.enqueueSubmarine,
+	})
+
+	if b.deploymentInformer != nil {
+		controller.deploymentsLister = b.deploymentInformer.Lister()
+		controller.deploymentsSynced = b.deploymentInformer.Informer().HasSynced
+		b.deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleObject,
+			UpdateFunc: func(old, new interface{}) {
+				controller.handleObject(new)
+			},
+			DeleteFunc: controller.handleObject,
+		})
+	}
+
+	if b.serviceInformer != nil {
+		controller.servicesLister = b.serviceInformer.Lister()
+		controller.servicesSynced = b.serviceInformer.Informer().HasSynced
+		b.serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleObject,
+			UpdateFunc: func(old, new interface{}) {
+				controller.handleObject(new)
+			},
+			DeleteFunc: controller.handleObject,
+		})
+	}
+
+	if b.podInformer != nil {
+		controller.podsLister = b.podInformer.Lister()
+		controller.podsSynced = b.podInformer.Informer().HasSynced
+		b.podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleObject,
+			UpdateFunc: func(old, new interface{}) {
+				controller.handleObject(new)
+			},
+			DeleteFunc: controller.handleObject,
+		})
+	}
+
+	if b.namespaceInformer != nil {
+		controller.namespacesLister = b.namespaceInformer.Lister()
+		controller.namespacesSynced = b.namespaceInformer.Informer().HasSynced
+		b.namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleNamespace,
+			UpdateFunc: func(old, new interface{}) {
+				controller.handleNamespace(new)
+			},
+			DeleteFunc: controller.handleNamespace,
+		})
+	}
+
+	return controller, nil
+}
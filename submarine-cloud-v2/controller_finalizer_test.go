@@ -0,0 +1,87 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "submarine-cloud-v2/pkg/apis/submarine/v1alpha1"
+	fakeclientset "submarine-cloud-v2/pkg/generated/clientset/versioned/fake"
+)
+
+func newTestSubmarine(name string, finalizers []string) *v1alpha1.Submarine {
+	return &v1alpha1.Submarine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Finalizers: finalizers,
+		},
+	}
+}
+
+func TestHasFinalizer(t *testing.T) {
+	c := &Controller{}
+
+	if !c.hasFinalizer(newTestSubmarine("with", []string{submarineFinalizer})) {
+		t.Errorf("expected hasFinalizer to report true for a submarine carrying %s", submarineFinalizer)
+	}
+	if c.hasFinalizer(newTestSubmarine("without", nil)) {
+		t.Errorf("expected hasFinalizer to report false for a submarine without a finalizer")
+	}
+}
+
+func TestAddFinalizer(t *testing.T) {
+	submarine := newTestSubmarine("test", nil)
+	client := fakeclientset.NewSimpleClientset(submarine)
+	c := &Controller{submarineclientset: client}
+
+	if err := c.addFinalizer(submarine); err != nil {
+		t.Fatalf("addFinalizer returned error: %v", err)
+	}
+
+	updated, err := client.SubmarineV1alpha1().Submarines(submarine.Namespace).Get(submarine.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to fetch updated submarine: %v", err)
+	}
+	if !c.hasFinalizer(updated) {
+		t.Errorf("expected finalizer %s to be present after addFinalizer", submarineFinalizer)
+	}
+}
+
+func TestRemoveFinalizer(t *testing.T) {
+	submarine := newTestSubmarine("test", []string{submarineFinalizer, "other.example.com/finalizer"})
+	client := fakeclientset.NewSimpleClientset(submarine)
+	c := &Controller{submarineclientset: client}
+
+	if err := c.removeFinalizer(submarine); err != nil {
+		t.Fatalf("removeFinalizer returned error: %v", err)
+	}
+
+	updated, err := client.SubmarineV1alpha1().Submarines(submarine.Namespace).Get(submarine.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to fetch updated submarine: %v", err)
+	}
+	if c.hasFinalizer(updated) {
+		t.Errorf("expected finalizer %s to be removed", submarineFinalizer)
+	}
+	if len(updated.Finalizers) != 1 || updated.Finalizers[0] != "other.example.com/finalizer" {
+		t.Errorf("expected other finalizers to be preserved, got %v", updated.Finalizers)
+	}
+}
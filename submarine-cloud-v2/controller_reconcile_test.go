@@ -0,0 +1,124 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	v1alpha1 "submarine-cloud-v2/pkg/apis/submarine/v1alpha1"
+)
+
+func newTestSubmarineForReconcile(name string) *v1alpha1.Submarine {
+	return &v1alpha1.Submarine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SubmarineSpec{
+			ServiceName: "test-service",
+			ServicePort: 8080,
+			Namespace:   "submarine-user-test",
+		},
+	}
+}
+
+func TestReconcileServicesCreatesMissingService(t *testing.T) {
+	submarine := newTestSubmarineForReconcile("test")
+	kubeClient := kubefake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	servicesInformer := informerFactory.Core().V1().Services()
+
+	c := &Controller{
+		kubeclientset:  kubeClient,
+		servicesLister: servicesInformer.Lister(),
+		recorder:       record.NewFakeRecorder(1),
+	}
+
+	ready, err := c.reconcileServices(submarine)
+	if err != nil {
+		t.Fatalf("reconcileServices returned error: %v", err)
+	}
+	if !ready {
+		t.Errorf("expected reconcileServices to report ready once the Service is created")
+	}
+
+	service, err := kubeClient.CoreV1().Services(submarine.Namespace).Get(submarine.Spec.ServiceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected reconcileServices to create %s: %v", submarine.Spec.ServiceName, err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != submarine.Spec.ServicePort {
+		t.Errorf("expected service port %d, got %+v", submarine.Spec.ServicePort, service.Spec.Ports)
+	}
+	if !metav1.IsControlledBy(service, submarine) {
+		t.Errorf("expected created service to be controlled by the submarine")
+	}
+}
+
+func TestReconcileServicesSkipsWithoutServiceName(t *testing.T) {
+	submarine := newTestSubmarineForReconcile("test")
+	submarine.Spec.ServiceName = ""
+	kubeClient := kubefake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+
+	c := &Controller{
+		kubeclientset:  kubeClient,
+		servicesLister: informerFactory.Core().V1().Services().Lister(),
+		recorder:       record.NewFakeRecorder(1),
+	}
+
+	ready, err := c.reconcileServices(submarine)
+	if err != nil {
+		t.Fatalf("reconcileServices returned error: %v", err)
+	}
+	if !ready {
+		t.Errorf("expected reconcileServices to report ready (nothing to do) when ServiceName is unset")
+	}
+
+	if services, err := kubeClient.CoreV1().Services(submarine.Namespace).List(metav1.ListOptions{}); err != nil || len(services.Items) != 0 {
+		t.Errorf("expected no Service to be created when ServiceName is unset")
+	}
+}
+
+func TestReconcileNamespaceCreatesMissingNamespace(t *testing.T) {
+	submarine := newTestSubmarineForReconcile("test")
+	kubeClient := kubefake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+
+	c := &Controller{
+		kubeclientset:    kubeClient,
+		namespacesLister: informerFactory.Core().V1().Namespaces().Lister(),
+		recorder:         record.NewFakeRecorder(1),
+	}
+
+	if _, err := c.reconcileNamespace(submarine); err != nil {
+		t.Fatalf("reconcileNamespace returned error: %v", err)
+	}
+
+	ns, err := kubeClient.CoreV1().Namespaces().Get(submarine.Spec.Namespace, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected reconcileNamespace to create %s: %v", submarine.Spec.Namespace, err)
+	}
+	if ns.Annotations[submarineNamespaceOwnerAnnotation] != "default/test" {
+		t.Errorf("expected namespace to be annotated with its owning submarine, got %q", ns.Annotations[submarineNamespaceOwnerAnnotation])
+	}
+}
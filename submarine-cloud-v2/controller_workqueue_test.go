@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	fakeclientset "submarine-cloud-v2/pkg/generated/clientset/versioned/fake"
+	externalversions "submarine-cloud-v2/pkg/generated/informers/externalversions"
+)
+
+func TestHandleSyncErrorRequeuesBelowMaxRetries(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")
+	recorder := record.NewFakeRecorder(1)
+	c := &Controller{workqueue: queue, recorder: recorder}
+
+	key := "default/test-submarine"
+	c.handleSyncError(key, fmt.Errorf("boom"))
+
+	if got := queue.NumRequeues(key); got != 1 {
+		t.Errorf("expected NumRequeues to be 1 after one handleSyncError call, got %d", got)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		t.Errorf("expected no event before maxRetries is reached, got %q", e)
+	default:
+	}
+}
+
+func TestHandleSyncErrorDropsAfterMaxRetries(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")
+	submarine := newTestSubmarine("test-submarine", nil)
+	submarineClient := fakeclientset.NewSimpleClientset(submarine)
+	informerFactory := externalversions.NewSharedInformerFactory(submarineClient, 0)
+	submarineInformer := informerFactory.Submarine().V1alpha1().Submarines()
+	if err := submarineInformer.Informer().GetStore().Add(submarine); err != nil {
+		t.Fatalf("failed to seed informer store: %v", err)
+	}
+
+	recorder := record.NewFakeRecorder(1)
+	c := &Controller{
+		workqueue:        queue,
+		recorder:         recorder,
+		submarinesLister: submarineInformer.Lister(),
+	}
+
+	key := "default/test-submarine"
+	for i := 0; i < maxRetries; i++ {
+		c.handleSyncError(key, fmt.Errorf("boom"))
+	}
+	if got := queue.NumRequeues(key); got != maxRetries {
+		t.Fatalf("expected %d requeues before dropping, got %d", maxRetries, got)
+	}
+
+	c.handleSyncError(key, fmt.Errorf("boom"))
+
+	if got := queue.NumRequeues(key); got != 0 {
+		t.Errorf("expected handleSyncError to Forget the key once maxRetries is reached, got NumRequeues=%d", got)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "SyncFailed") {
+			t.Errorf("expected a SyncFailed event, got %q", e)
+		}
+	default:
+		t.Errorf("expected a Warning event to be recorded once maxRetries is reached")
+	}
+}
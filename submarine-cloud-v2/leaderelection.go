@@ -0,0 +1,100 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	leaderElectionLeaseDuration = 15 * time.Second
+	leaderElectionRenewDeadline = 10 * time.Second
+	leaderElectionRetryPeriod   = 2 * time.Second
+)
+
+// RunWithLeaderElection wraps Run with client-go leader election: it starts
+// Controller.Run only once this pod has acquired the Lease named leaseName
+// in leaseNamespace, and closes the stop channel it passed to Run (causing
+// Run to shut its workers down) as soon as it loses leadership. Until the
+// Lease is acquired Run is not started at all. This is what lets
+// the operator be deployed with replicas > 1 without every replica racing
+// to install the same Helm releases. main wires this in behind a
+// `--leader-elect` flag, calling Run directly when it is unset.
+func (c *Controller) RunWithLeaderElection(ctx context.Context, kubeclientset kubernetes.Interface, leaseNamespace, leaseName string) error {
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		identity = string(uuid.NewUUID())
+	}
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		leaseNamespace,
+		leaseName,
+		kubeclientset.CoreV1(),
+		kubeclientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      identity,
+			EventRecorder: c.recorder,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create leader election lock: %v", err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	leaderelection.RunOrDie(runCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   leaderElectionLeaseDuration,
+		RenewDeadline:   leaderElectionRenewDeadline,
+		RetryPeriod:     leaderElectionRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				klog.Infof("%s: started leading", identity)
+				if err := c.Run(leaderCtx.Done()); err != nil {
+					klog.Errorf("%s: controller exited with error: %v", identity, err)
+				}
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("%s: stopped leading, exiting", identity)
+				cancel()
+			},
+			OnNewLeader: func(currentIdentity string) {
+				if currentIdentity == identity {
+					return
+				}
+				klog.Infof("new leader elected: %s", currentIdentity)
+			},
+		},
+	})
+
+	<-runCtx.Done()
+	return nil
+}
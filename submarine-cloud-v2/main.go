@@ -0,0 +1,146 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	clientset "submarine-cloud-v2/pkg/generated/clientset/versioned"
+	submarineinformers "submarine-cloud-v2/pkg/generated/informers/externalversions"
+	"submarine-cloud-v2/pkg/helm"
+)
+
+var (
+	masterURL            string
+	kubeconfig           string
+	workers              int
+	leaderElect          bool
+	leaderElectNamespace string
+	leaderElectLeaseName string
+)
+
+func init() {
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.IntVar(&workers, "workers", defaultWorkers, "Number of workers processing the Submarine workqueue.")
+	flag.BoolVar(&leaderElect, "leader-elect", false, "Enable leader election so only one replica of the operator is active when running with replicas > 1.")
+	flag.StringVar(&leaderElectNamespace, "leader-elect-namespace", "submarine-cloud", "Namespace the leader election Lease is created in.")
+	flag.StringVar(&leaderElectLeaseName, "leader-elect-lease-name", "submarine-controller", "Name of the leader election Lease.")
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	stopCh := setupSignalHandler()
+
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	if err != nil {
+		klog.Fatalf("Error building kubeconfig: %v", err)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building kubernetes clientset: %v", err)
+	}
+
+	submarineClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building submarine clientset: %v", err)
+	}
+
+	kubeInformerFactory := informers.NewSharedInformerFactory(kubeClient, time.Second*30)
+	submarineInformerFactory := submarineinformers.NewSharedInformerFactory(submarineClient, time.Second*30)
+
+	// Helm's action.Configuration binds its release storage and default
+	// client namespace to one namespace at Init() time, but each Submarine
+	// can target a different namespace. So instead of building one shared
+	// config, hand the ReleaseManager a factory that builds (and the
+	// manager caches) one per namespace it actually installs into.
+	helmDriver := os.Getenv("HELM_DRIVER")
+	helmReleaseManager := helm.NewReleaseManager(func(namespace string) (*action.Configuration, error) {
+		actionConfig := new(action.Configuration)
+		getter := kube.GetConfig(kubeconfig, "", namespace)
+		if err := actionConfig.Init(getter, namespace, helmDriver, klog.Infof); err != nil {
+			return nil, err
+		}
+		return actionConfig, nil
+	})
+
+	controller, err := NewControllerBuilder().
+		WithKubeClient(kubeClient).
+		WithSubmarineClient(submarineClient).
+		WithSubmarineInformer(submarineInformerFactory.Submarine().V1alpha1().Submarines()).
+		WithDeploymentInformer(kubeInformerFactory.Apps().V1().Deployments()).
+		WithServiceInformer(kubeInformerFactory.Core().V1().Services()).
+		WithPodInformer(kubeInformerFactory.Core().V1().Pods()).
+		WithNamespaceInformer(kubeInformerFactory.Core().V1().Namespaces()).
+		WithHelmReleaseManager(helmReleaseManager).
+		WithWorkers(workers).
+		Build()
+	if err != nil {
+		klog.Fatalf("Error building controller: %v", err)
+	}
+
+	kubeInformerFactory.Start(stopCh)
+	submarineInformerFactory.Start(stopCh)
+
+	if leaderElect {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stopCh
+			cancel()
+		}()
+		if err = controller.RunWithLeaderElection(ctx, kubeClient, leaderElectNamespace, leaderElectLeaseName); err != nil {
+			klog.Fatalf("Error running controller: %v", err)
+		}
+		return
+	}
+
+	if err = controller.Run(stopCh); err != nil {
+		klog.Fatalf("Error running controller: %v", err)
+	}
+}
+
+// setupSignalHandler returns a channel that's closed on the first
+// SIGINT/SIGTERM, so Controller.Run can shut its workers down gracefully; a
+// second signal forces an immediate exit.
+func setupSignalHandler() <-chan struct{} {
+	stopCh := make(chan struct{})
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		close(stopCh)
+		<-c
+		os.Exit(1)
+	}()
+	return stopCh
+}
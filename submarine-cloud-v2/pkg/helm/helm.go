@@ -0,0 +1,233 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package helm wraps the Helm SDK so the controller can install, upgrade and
+// uninstall the subcharts a Submarine CR needs without shelling out to the
+// helm binary.
+package helm
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/klog/v2"
+)
+
+// Values is the typed set of inputs a subchart is rendered with. It replaces
+// the old map[string]string of raw `--set` strings so that callers get
+// compile-time checking and IDE completion instead of hand-built Helm
+// expressions.
+type Values struct {
+	// Image is the container image the chart's workloads should run.
+	Image string
+	// Replicas is the number of replicas the chart's Deployment(s) should run.
+	Replicas int32
+	// Namespace is the namespace the release is installed into.
+	Namespace string
+	// Extra carries chart-specific overrides that don't have a typed field
+	// yet. It is merged on top of the typed fields above.
+	Extra map[string]interface{}
+}
+
+// toMap renders Values into the nested map[string]interface{} shape the
+// Helm SDK expects as chart values.
+func (v *Values) toMap() map[string]interface{} {
+	values := map[string]interface{}{
+		"image":     v.Image,
+		"replicas":  v.Replicas,
+		"namespace": v.Namespace,
+	}
+	for k, val := range v.Extra {
+		values[k] = val
+	}
+	return values
+}
+
+// ActionConfigFactory builds an *action.Configuration whose release storage
+// and default client namespace are bound to namespace. Helm's
+// action.Configuration.Init() call bakes the namespace in at construction
+// time, so a single shared configuration can't correctly list, install or
+// uninstall releases across more than one namespace; ReleaseManager calls
+// this once per distinct namespace instead of reusing one process-wide
+// configuration.
+type ActionConfigFactory func(namespace string) (*action.Configuration, error)
+
+// ReleaseManager owns the lifecycle of the Helm releases a Submarine CR
+// needs. Unlike the package-level HelmInstall/HelmUninstall helpers it
+// replaced, it checks the existing release list before acting so installing
+// the same release twice (e.g. after a controller restart) upgrades instead
+// of erroring out.
+type ReleaseManager struct {
+	newActionConfig ActionConfigFactory
+
+	mu            sync.Mutex
+	actionConfigs map[string]*action.Configuration
+}
+
+// NewReleaseManager returns a ReleaseManager that lazily builds one
+// *action.Configuration per target namespace via newActionConfig, caching
+// each one so repeated calls for the same namespace don't re-initialize it.
+// Tests can pass a factory that always returns the same
+// *action.Configuration wired to a fake Kubernetes client to exercise
+// InstallOrUpgrade/Uninstall without a real cluster.
+func NewReleaseManager(newActionConfig ActionConfigFactory) *ReleaseManager {
+	return &ReleaseManager{
+		newActionConfig: newActionConfig,
+		actionConfigs:   make(map[string]*action.Configuration),
+	}
+}
+
+// actionConfigFor returns the cached *action.Configuration for namespace,
+// building it via newActionConfig on first use.
+func (m *ReleaseManager) actionConfigFor(namespace string) (*action.Configuration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cfg, ok := m.actionConfigs[namespace]; ok {
+		return cfg, nil
+	}
+
+	cfg, err := m.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init helm action config for namespace %s: %v", namespace, err)
+	}
+	m.actionConfigs[namespace] = cfg
+	return cfg, nil
+}
+
+// InstallOrUpgrade installs releaseName from chartRef into namespace if it
+// doesn't exist yet, or upgrades it in place if it does. chartRef is
+// resolved by loadChart based on its URL scheme, so it can be a local
+// tarball path, an oci:// reference, or an http(s):// repo URL. The
+// returned release carries the chart version and revision that should be
+// recorded in Submarine.Status.HelmReleases.
+func (m *ReleaseManager) InstallOrUpgrade(releaseName, namespace, chartRef string, values *Values) (*release.Release, error) {
+	actionConfig, err := m.actionConfigFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	chrt, err := loadChart(chartRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart %s: %v", chartRef, err)
+	}
+
+	exists, err := m.releaseExists(actionConfig, releaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		klog.V(2).Infof("Helm release %s already exists in %s, upgrading", releaseName, namespace)
+		upgrade := action.NewUpgrade(actionConfig)
+		upgrade.Namespace = namespace
+		return upgrade.Run(releaseName, chrt, values.toMap())
+	}
+
+	klog.V(2).Infof("Installing helm release %s in %s", releaseName, namespace)
+	install := action.NewInstall(actionConfig)
+	install.ReleaseName = releaseName
+	install.Namespace = namespace
+	install.CreateNamespace = true
+	return install.Run(chrt, values.toMap())
+}
+
+// Uninstall removes releaseName from namespace, mirroring the behaviour of
+// the old package-level HelmUninstall.
+func (m *ReleaseManager) Uninstall(releaseName, namespace string) error {
+	actionConfig, err := m.actionConfigFor(namespace)
+	if err != nil {
+		return err
+	}
+	uninstall := action.NewUninstall(actionConfig)
+	_, err = uninstall.Run(releaseName)
+	return err
+}
+
+// releaseExists reports whether releaseName is already present in
+// actionConfig's namespace, by listing releases through action.List rather
+// than relying on the Install call to fail.
+func (m *ReleaseManager) releaseExists(actionConfig *action.Configuration, releaseName string) (bool, error) {
+	list := action.NewList(actionConfig)
+	list.All = true
+	releases, err := list.Run()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range releases {
+		if r.Name == releaseName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadChart resolves chartRef to a *chart.Chart based on its URL scheme:
+// a bare path or file:// is loaded as a local tarball/directory, oci:// is
+// pulled from an OCI registry, and http(s):// is fetched from a classic
+// Helm chart repo.
+func loadChart(chartRef string) (*chart.Chart, error) {
+	u, err := url.Parse(chartRef)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		return loader.Load(u.Path)
+	case "oci":
+		client, err := registry.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		pulled, err := client.Pull(chartRef)
+		if err != nil {
+			return nil, err
+		}
+		return loader.LoadArchive(pulled.Chart.Data)
+	case "http", "https":
+		destDir, err := os.MkdirTemp("", "submarine-chart-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(destDir)
+
+		dl := downloader.ChartDownloader{
+			Out:     io.Discard,
+			Getters: getter.All(cli.New()),
+			Verify:  downloader.VerifyNever,
+		}
+		path, _, err := dl.DownloadTo(chartRef, "", destDir)
+		if err != nil {
+			return nil, err
+		}
+		return loader.Load(path)
+	default:
+		return nil, fmt.Errorf("unsupported chart source scheme %q for %s", u.Scheme, chartRef)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helm
+
+import (
+	"io"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/klog/v2"
+)
+
+// newTestActionConfig returns an *action.Configuration backed by an
+// in-memory release store and Helm's own fake kube client, so
+// InstallOrUpgrade/Uninstall can be exercised without a real cluster.
+func newTestActionConfig(t *testing.T) *action.Configuration {
+	t.Helper()
+	return &action.Configuration{
+		Releases:   storage.Init(driver.NewMemory()),
+		KubeClient: &kubefake.PrintingKubeClient{Out: io.Discard},
+		Log:        func(format string, v ...interface{}) { klog.V(4).Infof(format, v...) },
+	}
+}
+
+func TestReleaseExists(t *testing.T) {
+	cfg := newTestActionConfig(t)
+	mgr := NewReleaseManager(func(namespace string) (*action.Configuration, error) {
+		return cfg, nil
+	})
+
+	exists, err := mgr.releaseExists(cfg, "missing-release")
+	if err != nil {
+		t.Fatalf("releaseExists returned error: %v", err)
+	}
+	if exists {
+		t.Fatalf("expected missing-release to not exist")
+	}
+
+	if err := cfg.Releases.Create(&release.Release{
+		Name:    "existing-release",
+		Version: 1,
+		Info:    &release.Info{Status: release.StatusDeployed},
+	}); err != nil {
+		t.Fatalf("failed to seed release store: %v", err)
+	}
+
+	exists, err = mgr.releaseExists(cfg, "existing-release")
+	if err != nil {
+		t.Fatalf("releaseExists returned error: %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected existing-release to exist")
+	}
+}
+
+// TestActionConfigForCachesPerNamespace checks that ReleaseManager builds at
+// most one *action.Configuration per namespace, and a different one per
+// distinct namespace, instead of reusing a single process-wide config.
+func TestActionConfigForCachesPerNamespace(t *testing.T) {
+	var calls []string
+	mgr := NewReleaseManager(func(namespace string) (*action.Configuration, error) {
+		calls = append(calls, namespace)
+		return newTestActionConfig(t), nil
+	})
+
+	first, err := mgr.actionConfigFor("submarine-user-a")
+	if err != nil {
+		t.Fatalf("actionConfigFor returned error: %v", err)
+	}
+	second, err := mgr.actionConfigFor("submarine-user-a")
+	if err != nil {
+		t.Fatalf("actionConfigFor returned error: %v", err)
+	}
+	if first != second {
+		t.Fatalf("expected actionConfigFor to cache the config for a repeated namespace")
+	}
+
+	if _, err := mgr.actionConfigFor("submarine-user-b"); err != nil {
+		t.Fatalf("actionConfigFor returned error: %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "submarine-user-a" || calls[1] != "submarine-user-b" {
+		t.Fatalf("expected one factory call per distinct namespace, got %v", calls)
+	}
+}
+
+func TestValuesToMap(t *testing.T) {
+	v := &Values{
+		Image:     "apache/submarine:0.8.0",
+		Replicas:  3,
+		Namespace: "submarine-user-test",
+		Extra:     map[string]interface{}{"storageClass": "standard"},
+	}
+
+	m := v.toMap()
+
+	if m["image"] != v.Image {
+		t.Errorf("image = %v, want %v", m["image"], v.Image)
+	}
+	if m["replicas"] != v.Replicas {
+		t.Errorf("replicas = %v, want %v", m["replicas"], v.Replicas)
+	}
+	if m["storageClass"] != "standard" {
+		t.Errorf("storageClass = %v, want standard", m["storageClass"])
+	}
+}